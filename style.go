@@ -1,9 +1,13 @@
 package chroma
 
 import (
+	"bufio"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 )
@@ -50,6 +54,13 @@ type StyleEntry struct {
 	Italic    Trilean
 	Underline Trilean
 	NoInherit bool
+	// Complete marks the entry as authoritative: unlike NoInherit, which only
+	// stops ancestor propagation within a single Inherit call, Complete also
+	// suppresses the category/subcategory/background fallback chain in
+	// Style.Get and the synthesised LineHighlight/LineNumbers fallback in
+	// Style.synthesise, guaranteeing the formatter sees exactly what the
+	// theme author wrote.
+	Complete bool
 }
 
 func (s StyleEntry) MarshalText() ([]byte, error) {
@@ -70,6 +81,9 @@ func (s StyleEntry) String() string {
 	if s.NoInherit {
 		out = append(out, "noinherit")
 	}
+	if s.Complete {
+		out = append(out, "complete")
+	}
 	if s.Colour.IsSet() {
 		out = append(out, s.Colour.String())
 	}
@@ -103,16 +117,25 @@ func (s StyleEntry) Sub(e StyleEntry) StyleEntry {
 	if e.Border != s.Border {
 		out.Border = s.Border
 	}
+	if e.Complete != s.Complete {
+		out.Complete = s.Complete
+	}
 	return out
 }
 
+// IsComplete reports whether the entry is sealed against inheritance and
+// fallback, see Complete.
+func (s StyleEntry) IsComplete() bool {
+	return s.Complete
+}
+
 // Inherit styles from ancestors.
 //
 // Ancestors should be provided from oldest to newest.
 func (s StyleEntry) Inherit(ancestors ...StyleEntry) StyleEntry {
 	out := s
 	for i := len(ancestors) - 1; i >= 0; i-- {
-		if out.NoInherit {
+		if out.NoInherit || out.Complete {
 			return out
 		}
 		ancestor := ancestors[i]
@@ -140,7 +163,7 @@ func (s StyleEntry) Inherit(ancestors ...StyleEntry) StyleEntry {
 
 func (s StyleEntry) IsZero() bool {
 	return s.Colour == 0 && s.Background == 0 && s.Border == 0 && s.Bold == Pass && s.Italic == Pass &&
-		s.Underline == Pass && !s.NoInherit
+		s.Underline == Pass && !s.NoInherit && !s.Complete
 }
 
 // A StyleBuilder is a mutable structure for building styles.
@@ -151,6 +174,16 @@ type StyleBuilder struct {
 	name    string
 	theme   string
 	parent  *Style
+	rules   []styleRuleBuilder
+}
+
+// styleRuleBuilder is a not-yet-compiled StyleRule; the pattern is validated
+// and compiled in Build(), mirroring how entry descriptors are only parsed
+// there.
+type styleRuleBuilder struct {
+	ttype   TokenType
+	pattern string
+	entry   StyleEntry
 }
 
 func NewStyleBuilder(name string, theme string) *StyleBuilder {
@@ -186,6 +219,15 @@ func (s *StyleBuilder) AddEntry(ttype TokenType, entry StyleEntry) *StyleBuilder
 	return s
 }
 
+// AddRule adds a content-matching rule: tokens of type ttype whose text
+// matches pattern are styled with entry instead of whatever ttype otherwise
+// resolves to. Rules are consulted in the order they were added, before
+// falling back to the plain TokenType entry; see Style.GetForToken.
+func (s *StyleBuilder) AddRule(ttype TokenType, pattern string, entry StyleEntry) *StyleBuilder {
+	s.rules = append(s.rules, styleRuleBuilder{ttype: ttype, pattern: pattern, entry: entry})
+	return s
+}
+
 // Transform passes each style entry currently defined in the builder to the supplied
 // function and saves the returned value. This can be used to adjust a style's colours;
 // see Colour's ClampBrightness function, for example.
@@ -205,6 +247,31 @@ func (s *StyleBuilder) Transform(transform func(StyleEntry) StyleEntry) *StyleBu
 	return s
 }
 
+// Use applies a sequence of registered StyleTransforms to every entry
+// currently defined in the builder (including inherited ones), in order.
+// Unlike Transform, each StyleTransform also sees the style's resolved
+// Background, which built-ins such as MinContrastTransform need.
+func (s *StyleBuilder) Use(transforms ...StyleTransform) *StyleBuilder {
+	types := make(map[TokenType]struct{})
+	for tt := range s.entries {
+		types[tt] = struct{}{}
+	}
+	if s.parent != nil {
+		for _, tt := range s.parent.Types() {
+			types[tt] = struct{}{}
+		}
+	}
+	bg := s.Get(Background)
+	for tt := range types {
+		entry := s.Get(tt)
+		for _, t := range transforms {
+			entry = t.Apply(entry, bg)
+		}
+		s.AddEntry(tt, entry)
+	}
+	return s
+}
+
 func (s *StyleBuilder) Build() (*Style, error) {
 	style := &Style{
 		Name:    s.name,
@@ -219,6 +286,13 @@ func (s *StyleBuilder) Build() (*Style, error) {
 		}
 		style.entries[ttype] = entry
 	}
+	for _, rule := range s.rules {
+		pattern, err := regexp.Compile(rule.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule pattern %q for %s: %s", rule.pattern, rule.ttype, err)
+		}
+		style.rules = append(style.rules, StyleRule{Type: rule.ttype, Pattern: pattern, Entry: rule.entry})
+	}
 	return style, nil
 }
 
@@ -232,6 +306,282 @@ func NewXMLStyle(r io.Reader) (*Style, error) {
 	return style, dec.Decode(style)
 }
 
+// NewINIStyle parses a style definition from an INI-style ".styleset" file.
+//
+// Each TokenType gets its own section (e.g. "[Comment]") with fg, bg,
+// border, bold, italic, underline, noinherit and complete keys. A top-level
+// "[style]" section carries the style's name and theme. Values are "default" (Pass),
+// "true"/"false" (Yes/No), or hex colours such as "#f92672". This gives
+// users a friendlier hand-edit format than XML, and styles written this way
+// round-trip via Style.WriteINI.
+func NewINIStyle(r io.Reader) (*Style, error) {
+	sections, err := parseINI(r)
+	if err != nil {
+		return nil, err
+	}
+	builder := NewStyleBuilder("", "")
+	for name, kv := range sections {
+		if name == "style" {
+			builder.name = kv["name"]
+			builder.theme = kv["theme"]
+			continue
+		}
+		ttype, err := TokenTypeString(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown section [%s]: %s", name, err)
+		}
+		entry, err := iniStyleEntry(kv)
+		if err != nil {
+			return nil, fmt.Errorf("[%s]: %s", name, err)
+		}
+		builder.AddEntry(ttype, entry)
+	}
+	if builder.name == "" {
+		return nil, fmt.Errorf("missing [style] section or name")
+	}
+	return builder.Build()
+}
+
+// MustNewINIStyle is like NewINIStyle but panics on error.
+func MustNewINIStyle(r io.Reader) *Style {
+	style, err := NewINIStyle(r)
+	if err != nil {
+		panic(err)
+	}
+	return style
+}
+
+// LoadStylesetDir loads every "*.styleset" file found in paths and returns
+// the resulting styles keyed by name. The styles package uses this to
+// populate styles.Registry without chroma having to import it.
+func LoadStylesetDir(paths ...string) (map[string]*Style, error) {
+	out := map[string]*Style{}
+	for _, path := range paths {
+		matches, err := filepath.Glob(filepath.Join(path, "*.styleset"))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			style, err := loadStyleset(match)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", match, err)
+			}
+			out[style.Name] = style
+		}
+	}
+	return out, nil
+}
+
+func loadStyleset(path string) (*Style, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint: errcheck
+	return NewINIStyle(f)
+}
+
+// WriteINI writes the style in the .styleset format understood by
+// NewINIStyle.
+func (s *Style) WriteINI(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "[style]\nname = %s\ntheme = %s\n", s.Name, s.Theme); err != nil {
+		return err
+	}
+	sorted := make([]TokenType, 0, len(s.entries))
+	for ttype := range s.entries {
+		sorted = append(sorted, ttype)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for _, ttype := range sorted {
+		if _, err := fmt.Fprintf(w, "\n[%s]\n", ttype); err != nil {
+			return err
+		}
+		if err := writeINIStyleEntry(w, s.entries[ttype]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseINI does a minimal parse of an INI file into section -> key -> value,
+// lower-casing keys. It doesn't support quoting or line continuations;
+// .styleset files don't need them.
+func parseINI(r io.Reader) (map[string]map[string]string, error) {
+	sections := map[string]map[string]string{}
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: malformed section header %q", lineNum, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := sections[section]; !ok {
+				sections[section] = map[string]string{}
+			}
+			continue
+		}
+		if section == "" {
+			return nil, fmt.Errorf("line %d: key outside of a section", lineNum)
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", lineNum, line)
+		}
+		sections[section][strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
+
+func iniStyleEntry(kv map[string]string) (StyleEntry, error) {
+	entry := StyleEntry{}
+	var err error
+	if entry.Colour, err = iniColour(kv["fg"]); err != nil {
+		return entry, fmt.Errorf("fg: %s", err)
+	}
+	if entry.Background, err = iniColour(kv["bg"]); err != nil {
+		return entry, fmt.Errorf("bg: %s", err)
+	}
+	if entry.Border, err = iniColour(kv["border"]); err != nil {
+		return entry, fmt.Errorf("border: %s", err)
+	}
+	if entry.Bold, err = iniTrilean(kv["bold"]); err != nil {
+		return entry, fmt.Errorf("bold: %s", err)
+	}
+	if entry.Italic, err = iniTrilean(kv["italic"]); err != nil {
+		return entry, fmt.Errorf("italic: %s", err)
+	}
+	if entry.Underline, err = iniTrilean(kv["underline"]); err != nil {
+		return entry, fmt.Errorf("underline: %s", err)
+	}
+	noInherit, err := iniTrilean(kv["noinherit"])
+	if err != nil {
+		return entry, fmt.Errorf("noinherit: %s", err)
+	}
+	entry.NoInherit = noInherit == Yes
+	complete, err := iniTrilean(kv["complete"])
+	if err != nil {
+		return entry, fmt.Errorf("complete: %s", err)
+	}
+	entry.Complete = complete == Yes
+	return entry, nil
+}
+
+func writeINIStyleEntry(w io.Writer, entry StyleEntry) error {
+	_, err := fmt.Fprintf(w, "fg = %s\nbg = %s\nborder = %s\nbold = %s\nitalic = %s\nunderline = %s\nnoinherit = %s\ncomplete = %s\n",
+		iniColourString(entry.Colour), iniColourString(entry.Background), iniColourString(entry.Border),
+		iniTrileanString(entry.Bold), iniTrileanString(entry.Italic), iniTrileanString(entry.Underline),
+		iniTrileanString(boolTrilean(entry.NoInherit)), iniTrileanString(boolTrilean(entry.Complete)))
+	return err
+}
+
+func boolTrilean(b bool) Trilean {
+	if b {
+		return Yes
+	}
+	return No
+}
+
+func iniColour(value string) (Colour, error) {
+	if value == "" || value == "default" {
+		return 0, nil
+	}
+	colour := ParseColour(value)
+	if !colour.IsSet() {
+		return 0, fmt.Errorf("invalid colour %q", value)
+	}
+	return colour, nil
+}
+
+func iniColourString(c Colour) string {
+	if !c.IsSet() {
+		return "default"
+	}
+	return c.String()
+}
+
+func iniTrilean(value string) (Trilean, error) {
+	switch value {
+	case "", "default":
+		return Pass, nil
+	case "true":
+		return Yes, nil
+	case "false":
+		return No, nil
+	default:
+		return Pass, fmt.Errorf("invalid value %q, expected default, true or false", value)
+	}
+}
+
+func iniTrileanString(t Trilean) string {
+	switch t {
+	case Yes:
+		return "true"
+	case No:
+		return "false"
+	default:
+		return "default"
+	}
+}
+
+// NewXMLLayeredStyle parses base and each of overlays as XML style
+// definitions and composes them into a single layered style via
+// NewLayeredStyle, in the order given.
+func NewXMLLayeredStyle(base io.Reader, overlays ...io.Reader) (*Style, error) {
+	baseStyle, err := NewXMLStyle(base)
+	if err != nil {
+		return nil, err
+	}
+	overlayStyles := make([]*Style, 0, len(overlays))
+	for _, r := range overlays {
+		overlay, err := NewXMLStyle(r)
+		if err != nil {
+			return nil, err
+		}
+		overlayStyles = append(overlayStyles, overlay)
+	}
+	return NewLayeredStyle(baseStyle, overlayStyles...), nil
+}
+
+// StyleResolver resolves a registered style by name.
+//
+// It is used to implement cross-file style inheritance (the "inherits"
+// attribute and "include" element on the XML <style> root) and is populated
+// by the styles package's init function, to avoid an import cycle between
+// chroma and styles.
+var StyleResolver func(name string) (*Style, bool)
+
+func resolveIncludedStyle(name string) (*Style, error) {
+	if StyleResolver == nil {
+		return nil, fmt.Errorf("no style registry configured, cannot resolve included style %q", name)
+	}
+	parent, ok := StyleResolver(name)
+	if !ok {
+		return nil, fmt.Errorf("included style %q is not registered", name)
+	}
+	return parent, nil
+}
+
+// checkStyleInheritanceCycle returns an error if setting parent as the parent
+// of a style named "name" would introduce a cycle.
+func checkStyleInheritanceCycle(name string, parent *Style) error {
+	seen := map[string]bool{name: true}
+	for p := parent; p != nil; p = p.parent {
+		if seen[p.Name] {
+			return fmt.Errorf("style inheritance cycle detected at %q", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
+
 // MustNewXMLStyle is like NewXMLStyle but panics on error.
 func MustNewXMLStyle(r io.Reader) *Style {
 	style, err := NewXMLStyle(r)
@@ -263,17 +613,118 @@ type Style struct {
 	Theme   string
 	entries map[TokenType]StyleEntry
 	parent  *Style
+	// layers holds the stack built by NewLayeredStyle, base first. Nil for a
+	// regular, non-layered style.
+	layers []*Style
+	rules  []StyleRule
+	// transforms are set by WithTransforms and applied lazily, by
+	// applyTransforms, to whatever Get or GetForToken resolves.
+	transforms []StyleTransform
 }
 
-func (s *Style) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+// WithTransforms returns a cheap, lazily-transformed view of the style: each
+// entry is passed through transforms only when requested via Get/GetForToken,
+// rather than eagerly rewriting every entry up front. This lets a single
+// parsed style serve multiple callers - e.g. a light-terminal and a
+// dark-terminal variant - without re-parsing the source style.
+func (s *Style) WithTransforms(transforms ...StyleTransform) *Style {
+	return &Style{
+		Name:       s.Name,
+		Theme:      s.Theme,
+		parent:     s,
+		entries:    map[TokenType]StyleEntry{},
+		transforms: transforms,
+	}
+}
+
+// A StyleRule styles tokens of Type whose text matches Pattern with Entry,
+// taking precedence over the plain TokenType lookup done by Style.Get. See
+// StyleBuilder.AddRule and Style.GetForToken.
+type StyleRule struct {
+	Type    TokenType
+	Pattern *regexp.Regexp
+	Entry   StyleEntry
+}
+
+// GetForToken is like Get, but additionally consults tok's content against
+// any StyleRules registered for its TokenType (see StyleBuilder.AddRule),
+// applying the first matching rule's entry instead of the plain TokenType
+// style. This lets theme authors highlight specific identifiers - TODO
+// comments, self/this, particular builtin names - without lexer changes.
+func (s *Style) GetForToken(tok Token) StyleEntry {
+	for _, rule := range s.rulesChain() {
+		if rule.Type == tok.Type && rule.Pattern.MatchString(tok.Value) {
+			return s.applyTransforms(rule.Entry)
+		}
+	}
+	return s.Get(tok.Type)
+}
+
+// rulesChain returns this style's own rules followed by its ancestors' (most
+// specific first), so a derived or overlay style's rules take precedence.
+func (s *Style) rulesChain() []StyleRule {
+	var rules []StyleRule
+	rules = append(rules, s.rules...)
+	for i := len(s.layers) - 1; i >= 0; i-- {
+		rules = append(rules, s.layers[i].rulesChain()...)
+	}
 	if s.parent != nil {
-		return fmt.Errorf("cannot marshal style with parent")
+		rules = append(rules, s.parent.rulesChain()...)
+	}
+	return rules
+}
+
+// NewLayeredStyle composes base with an ordered list of overlays, where each
+// overlay only needs to define the entries it wants to contribute on top of
+// the layers beneath it. Get walks the stack from the topmost overlay down
+// to base, honouring NoInherit at each layer, so a single token can receive
+// contributions from several independent style sheets (e.g. a base theme
+// plus a line-highlight overlay plus a diff-annotations overlay).
+func NewLayeredStyle(base *Style, overlays ...*Style) *Style {
+	layers := make([]*Style, 0, len(overlays)+1)
+	layers = append(layers, base)
+	layers = append(layers, overlays...)
+	return &Style{
+		Name:   base.Name,
+		Theme:  base.Theme,
+		layers: layers,
+	}
+}
+
+// Layers returns the ordered stack of styles composed by NewLayeredStyle,
+// from base to topmost overlay. It returns nil for a style that isn't
+// layered.
+func (s *Style) Layers() []*Style {
+	return s.layers
+}
+
+func (s *Style) getLayered(ttype TokenType) StyleEntry {
+	out := StyleEntry{}
+	for i := len(s.layers) - 1; i >= 0; i-- {
+		entry := s.layers[i].get(ttype)
+		out = out.Inherit(entry)
+		if entry.Complete {
+			out.Complete = true
+		}
+		if entry.NoInherit || entry.Complete {
+			break
+		}
+	}
+	return out
+}
+
+func (s *Style) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if len(s.layers) > 0 {
+		return fmt.Errorf("cannot marshal a layered style (built with NewLayeredStyle); marshal its individual layers instead")
 	}
 	start.Name = xml.Name{Local: "style"}
 	start.Attr = []xml.Attr{
 		{Name: xml.Name{Local: "name"}, Value: s.Name},
 		{Name: xml.Name{Local: "theme"}, Value: s.Theme},
 	}
+	if s.parent != nil {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "inherits"}, Value: s.parent.Name})
+	}
 	if err := e.EncodeToken(start); err != nil {
 		return err
 	}
@@ -284,6 +735,13 @@ func (s *Style) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
 	for _, ttype := range sorted {
 		entry := s.entries[ttype]
+		// Only emit entries that differ from the resolved parent's, so a
+		// derived style stays small and re-inherits every entry it doesn't
+		// override. A differing entry is written whole, because on re-parse
+		// it replaces the parent's entry rather than merging with it.
+		if s.parent != nil && entry == s.parent.get(ttype) {
+			continue
+		}
 		el := xml.StartElement{Name: xml.Name{Local: "entry"}}
 		el.Attr = []xml.Attr{
 			{Name: xml.Name{Local: "type"}, Value: ttype.String()},
@@ -296,15 +754,39 @@ func (s *Style) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 			return err
 		}
 	}
+	rules := append([]StyleRule{}, s.rules...)
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Type != rules[j].Type {
+			return rules[i].Type < rules[j].Type
+		}
+		return rules[i].Pattern.String() < rules[j].Pattern.String()
+	})
+	for _, rule := range rules {
+		el := xml.StartElement{Name: xml.Name{Local: "entry"}}
+		el.Attr = []xml.Attr{
+			{Name: xml.Name{Local: "type"}, Value: rule.Type.String()},
+			{Name: xml.Name{Local: "style"}, Value: rule.Entry.String()},
+			{Name: xml.Name{Local: "match"}, Value: rule.Pattern.String()},
+		}
+		if err := e.EncodeToken(el); err != nil {
+			return err
+		}
+		if err := e.EncodeToken(xml.EndElement{Name: el.Name}); err != nil {
+			return err
+		}
+	}
 	return e.EncodeToken(xml.EndElement{Name: start.Name})
 }
 
 func (s *Style) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var inherits string
 	for _, attr := range start.Attr {
 		if attr.Name.Local == "name" {
 			s.Name = attr.Value
 		} else if attr.Name.Local == "theme" {
 			s.Theme = attr.Value
+		} else if attr.Name.Local == "inherits" {
+			inherits = attr.Value
 		} else {
 			return fmt.Errorf("unexpected attribute %s", attr.Name.Local)
 		}
@@ -315,6 +797,16 @@ func (s *Style) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	if s.Theme == "" {
 		return fmt.Errorf("missing style theme attribute")
 	}
+	if inherits != "" {
+		parent, err := resolveIncludedStyle(inherits)
+		if err != nil {
+			return err
+		}
+		if err := checkStyleInheritanceCycle(s.Name, parent); err != nil {
+			return err
+		}
+		s.parent = parent
+	}
 	s.entries = map[TokenType]StyleEntry{}
 	for {
 		tok, err := d.Token()
@@ -323,30 +815,59 @@ func (s *Style) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 		}
 		switch el := tok.(type) {
 		case xml.StartElement:
-			if el.Name.Local != "entry" {
-				return fmt.Errorf("unexpected element %s", el.Name.Local)
-			}
-			var ttype TokenType
-			var entry StyleEntry
-			for _, attr := range el.Attr {
-				switch attr.Name.Local {
-				case "type":
-					ttype, err = TokenTypeString(attr.Value)
-					if err != nil {
-						return err
-					}
+			switch el.Name.Local {
+			case "include":
+				name, err := includeAttr(el)
+				if err != nil {
+					return err
+				}
+				parent, err := resolveIncludedStyle(name)
+				if err != nil {
+					return err
+				}
+				if err := checkStyleInheritanceCycle(s.Name, parent); err != nil {
+					return err
+				}
+				s.parent = parent
+
+			case "entry":
+				var ttype TokenType
+				var entry StyleEntry
+				var match string
+				for _, attr := range el.Attr {
+					switch attr.Name.Local {
+					case "type":
+						ttype, err = TokenTypeString(attr.Value)
+						if err != nil {
+							return err
+						}
+
+					case "style":
+						entry, err = ParseStyleEntry(attr.Value)
+						if err != nil {
+							return err
+						}
 
-				case "style":
-					entry, err = ParseStyleEntry(attr.Value)
+					case "match":
+						match = attr.Value
+
+					default:
+						return fmt.Errorf("unexpected attribute %s", attr.Name.Local)
+					}
+				}
+				if match != "" {
+					pattern, err := regexp.Compile(match)
 					if err != nil {
-						return err
+						return fmt.Errorf("invalid match pattern %q for %s: %s", match, ttype, err)
 					}
-
-				default:
-					return fmt.Errorf("unexpected attribute %s", attr.Name.Local)
+					s.rules = append(s.rules, StyleRule{Type: ttype, Pattern: pattern, Entry: entry})
+				} else {
+					s.entries[ttype] = entry
 				}
+
+			default:
+				return fmt.Errorf("unexpected element %s", el.Name.Local)
 			}
-			s.entries[ttype] = entry
 
 		case xml.EndElement:
 			if el.Name.Local == start.Name.Local {
@@ -356,6 +877,16 @@ func (s *Style) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	}
 }
 
+// includeAttr extracts the "name" attribute from an <include> element.
+func includeAttr(el xml.StartElement) (string, error) {
+	for _, attr := range el.Attr {
+		if attr.Name.Local == "name" {
+			return attr.Value, nil
+		}
+	}
+	return "", fmt.Errorf("<include> missing name attribute")
+}
+
 // Types that are styled.
 func (s *Style) Types() []TokenType {
 	dedupe := map[TokenType]bool{}
@@ -367,6 +898,11 @@ func (s *Style) Types() []TokenType {
 			dedupe[tt] = true
 		}
 	}
+	for _, layer := range s.layers {
+		for _, tt := range layer.Types() {
+			dedupe[tt] = true
+		}
+	}
 	out := make([]TokenType, 0, len(dedupe))
 	for tt := range dedupe {
 		out = append(out, tt)
@@ -376,7 +912,10 @@ func (s *Style) Types() []TokenType {
 
 // Builder creates a mutable builder from this Style.
 //
-// The builder can then be safely modified. This is a cheap operation.
+// The builder can then be safely modified. This is a cheap operation. If s
+// is a layered style, the returned builder flattens it: Get() on a layered
+// parent already resolves the full stack, so the builder sees one coherent
+// set of entries.
 func (s *Style) Builder() *StyleBuilder {
 	return &StyleBuilder{
 		name:    s.Name,
@@ -396,15 +935,52 @@ func (s *Style) Has(ttype TokenType) bool {
 // Get a style entry. Will try sub-category or category if an exact match is not found, and
 // finally return the Background.
 func (s *Style) Get(ttype TokenType) StyleEntry {
-	return s.get(ttype).Inherit(
+	entry := s.get(ttype).Inherit(
 		s.get(Background),
 		s.get(Text),
 		s.get(ttype.Category()),
 		s.get(ttype.SubCategory()))
+	return s.applyTransforms(entry)
+}
+
+// applyTransforms runs entry through the transforms set by WithTransforms,
+// using the style's resolved Background. Transforms are inherited like any
+// other style property: a style with none of its own (e.g. one produced by
+// Builder().Build() on a transformed style) uses its parent's, so a rule-
+// matched entry from GetForToken or a Builder()-derived style stay
+// consistent with what Get returns.
+func (s *Style) applyTransforms(entry StyleEntry) StyleEntry {
+	transforms := s.effectiveTransforms()
+	if len(transforms) == 0 {
+		return entry
+	}
+	bg := s.get(Background)
+	for _, t := range transforms {
+		entry = t.Apply(entry, bg)
+	}
+	return entry
+}
+
+// effectiveTransforms returns this style's own transforms, or the nearest
+// ancestor's if it has none.
+func (s *Style) effectiveTransforms() []StyleTransform {
+	if len(s.transforms) > 0 {
+		return s.transforms
+	}
+	if s.parent != nil {
+		return s.parent.effectiveTransforms()
+	}
+	return nil
 }
 
 func (s *Style) get(ttype TokenType) StyleEntry {
+	if len(s.layers) > 0 {
+		return s.getLayered(ttype)
+	}
 	out := s.entries[ttype]
+	if out.IsComplete() {
+		return out
+	}
 	if out.IsZero() && s.parent != nil {
 		return s.parent.get(ttype)
 	}
@@ -468,6 +1044,8 @@ func ParseStyleEntry(entry string) (StyleEntry, error) { // nolint: gocyclo
 			out.NoInherit = false
 		case part == "noinherit":
 			out.NoInherit = true
+		case part == "complete":
+			out.Complete = true
 		case part == "bg:":
 			out.Background = 0
 		case strings.HasPrefix(part, "bg:#"):
@@ -0,0 +1,299 @@
+package chroma
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestStyleRuleXMLRoundTrip(t *testing.T) {
+	style, err := NewStyleBuilder("test", "test").
+		AddEntry(Comment, StyleEntry{Colour: NewColour(100, 100, 100)}).
+		AddRule(Comment, "TODO", StyleEntry{Colour: NewColour(255, 0, 0), Bold: Yes}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := xml.Marshal(style)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roundTripped, err := NewXMLStyle(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unmarshal: %s\n%s", err, data)
+	}
+
+	if len(roundTripped.rules) != 1 {
+		t.Fatalf("expected 1 rule, got %d: %s", len(roundTripped.rules), data)
+	}
+	rule := roundTripped.rules[0]
+	if rule.Type != Comment || rule.Pattern.String() != "TODO" || rule.Entry.Colour != NewColour(255, 0, 0) || rule.Entry.Bold != Yes {
+		t.Fatalf("rule mismatch: %+v\n%s", rule, data)
+	}
+}
+
+func TestINIStyleCompleteRoundTrip(t *testing.T) {
+	style, err := NewStyleBuilder("test", "test").
+		AddEntry(Comment, StyleEntry{Colour: NewColour(100, 100, 100), Complete: true}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := style.WriteINI(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	roundTripped, err := NewINIStyle(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !roundTripped.entries[Comment].Complete {
+		t.Fatalf("expected complete=true to survive a WriteINI/NewINIStyle round trip, got %+v", roundTripped.entries[Comment])
+	}
+}
+
+func TestStyleInheritanceCycleDetected(t *testing.T) {
+	a, err := NewStyleBuilder("a", "test").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewStyleBuilder("b", "test").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.parent = a
+
+	if err := checkStyleInheritanceCycle("a", b); err == nil {
+		t.Fatal("expected a cycle to be detected when a style would become its own ancestor")
+	}
+	if err := checkStyleInheritanceCycle("c", b); err != nil {
+		t.Fatalf("unrelated style name should not be flagged as a cycle: %s", err)
+	}
+}
+
+func TestNewLayeredStyleGet(t *testing.T) {
+	base, err := NewStyleBuilder("base", "test").
+		AddEntry(Comment, StyleEntry{Colour: NewColour(100, 100, 100), Bold: Yes}).
+		AddEntry(Keyword, StyleEntry{Colour: NewColour(0, 0, 200)}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay, err := NewStyleBuilder("overlay", "test").
+		AddEntry(Comment, StyleEntry{Colour: NewColour(200, 0, 0)}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layered := NewLayeredStyle(base, overlay)
+
+	// The overlay's colour wins, but the base's Bold, which the overlay
+	// didn't set, still shows through.
+	comment := layered.Get(Comment)
+	if comment.Colour != NewColour(200, 0, 0) {
+		t.Fatalf("expected overlay colour to win, got %v", comment.Colour)
+	}
+	if comment.Bold != Yes {
+		t.Fatalf("expected base's Bold to still apply where the overlay didn't set one, got %v", comment.Bold)
+	}
+
+	// A token the overlay never mentions falls through to the base untouched.
+	keyword := layered.Get(Keyword)
+	if keyword.Colour != NewColour(0, 0, 200) {
+		t.Fatalf("expected base colour for a token the overlay doesn't touch, got %v", keyword.Colour)
+	}
+}
+
+func TestNewLayeredStyleNoInheritStopsLowerLayers(t *testing.T) {
+	base, err := NewStyleBuilder("base", "test").
+		AddEntry(Comment, StyleEntry{Colour: NewColour(100, 100, 100), Bold: Yes}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay, err := NewStyleBuilder("overlay", "test").
+		AddEntry(Comment, StyleEntry{Colour: NewColour(200, 0, 0), NoInherit: true}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comment := NewLayeredStyle(base, overlay).Get(Comment)
+	if comment.Bold == Yes {
+		t.Fatalf("expected overlay's NoInherit to stop the base's Bold from showing through, got %v", comment.Bold)
+	}
+}
+
+func TestNewLayeredStyleMarshalXMLErrors(t *testing.T) {
+	base, err := NewStyleBuilder("base", "test").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay, err := NewStyleBuilder("overlay", "test").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := xml.Marshal(NewLayeredStyle(base, overlay)); err == nil {
+		t.Fatal("expected marshalling a layered style to fail rather than silently drop its layers")
+	}
+}
+
+// withStyleResolver temporarily installs resolve as StyleResolver for the
+// duration of the test, restoring the previous value on cleanup.
+func withStyleResolver(t *testing.T, resolve func(name string) (*Style, bool)) {
+	t.Helper()
+	old := StyleResolver
+	StyleResolver = resolve
+	t.Cleanup(func() { StyleResolver = old })
+}
+
+func TestStyleXMLInheritsAttribute(t *testing.T) {
+	parent, err := NewStyleBuilder("parent", "test").
+		AddEntry(Comment, StyleEntry{Colour: NewColour(100, 100, 100)}).
+		AddEntry(Keyword, StyleEntry{Colour: NewColour(0, 0, 200)}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	withStyleResolver(t, func(name string) (*Style, bool) {
+		if name == "parent" {
+			return parent, true
+		}
+		return nil, false
+	})
+
+	doc := `<style name="child" theme="test" inherits="parent">
+		<entry type="Keyword" style="#ff0000"></entry>
+	</style>`
+	child, err := NewXMLStyle(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := child.Get(Comment).Colour; got != NewColour(100, 100, 100) {
+		t.Fatalf("expected Comment to be inherited from the parent style, got %v", got)
+	}
+	if got := child.Get(Keyword).Colour; got != NewColour(255, 0, 0) {
+		t.Fatalf("expected child's own Keyword override to win, got %v", got)
+	}
+}
+
+func TestStyleXMLIncludeElement(t *testing.T) {
+	parent, err := NewStyleBuilder("parent2", "test").
+		AddEntry(Comment, StyleEntry{Colour: NewColour(100, 100, 100)}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	withStyleResolver(t, func(name string) (*Style, bool) {
+		if name == "parent2" {
+			return parent, true
+		}
+		return nil, false
+	})
+
+	doc := `<style name="child2" theme="test">
+		<include name="parent2"></include>
+	</style>`
+	child, err := NewXMLStyle(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := child.Get(Comment).Colour; got != NewColour(100, 100, 100) {
+		t.Fatalf("expected Comment to be inherited via <include>, got %v", got)
+	}
+}
+
+func TestStyleXMLInheritsUnresolvedFails(t *testing.T) {
+	withStyleResolver(t, func(name string) (*Style, bool) { return nil, false })
+
+	doc := `<style name="child" theme="test" inherits="missing"></style>`
+	if _, err := NewXMLStyle(strings.NewReader(doc)); err == nil {
+		t.Fatal("expected an error when the inherited style is not registered")
+	}
+}
+
+func TestStyleXMLDerivedRoundTrip(t *testing.T) {
+	parent, err := NewStyleBuilder("parent3", "test").
+		AddEntry(Comment, StyleEntry{Colour: NewColour(100, 100, 100)}).
+		AddEntry(Keyword, StyleEntry{Colour: NewColour(0, 0, 200)}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	derived, err := parent.Builder().AddEntry(Keyword, StyleEntry{Colour: NewColour(255, 0, 0)}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	derived.Name = "child3"
+
+	withStyleResolver(t, func(name string) (*Style, bool) {
+		if name == "parent3" {
+			return parent, true
+		}
+		return nil, false
+	})
+
+	data, err := xml.Marshal(derived)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roundTripped, err := NewXMLStyle(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unmarshal: %s\n%s", err, data)
+	}
+
+	if got := roundTripped.Get(Comment).Colour; got != NewColour(100, 100, 100) {
+		t.Fatalf("expected the re-parsed style to re-inherit Comment from its parent, got %v\n%s", got, data)
+	}
+	if got := roundTripped.Get(Keyword).Colour; got != NewColour(255, 0, 0) {
+		t.Fatalf("expected the re-parsed style's own Keyword override to survive, got %v\n%s", got, data)
+	}
+}
+
+func TestStyleEntryCompleteSuppressesFallbackChain(t *testing.T) {
+	style, err := NewStyleBuilder("test", "test").
+		AddEntry(Background, StyleEntry{Background: NewColour(20, 20, 20)}).
+		AddEntry(Text, StyleEntry{Colour: NewColour(200, 200, 200)}).
+		AddEntry(Comment, StyleEntry{Bold: Yes, Complete: true}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := style.Get(Comment)
+	if entry.Colour.IsSet() {
+		t.Fatalf("expected a Complete entry to not inherit Text's colour, got %v", entry.Colour)
+	}
+	if entry.Background.IsSet() {
+		t.Fatalf("expected a Complete entry to not inherit the Background, got %v", entry.Background)
+	}
+	if entry.Bold != Yes {
+		t.Fatalf("expected the entry's own Bold to still apply, got %v", entry.Bold)
+	}
+}
+
+func TestStyleEntryCompleteSuppressesSynthesise(t *testing.T) {
+	style, err := NewStyleBuilder("test", "test").
+		AddEntry(Background, StyleEntry{Background: NewColour(20, 20, 20)}).
+		AddEntry(LineHighlight, StyleEntry{Complete: true}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := style.Get(LineHighlight)
+	if entry.Background.IsSet() {
+		t.Fatalf("expected a Complete LineHighlight to not be synthesised from Background, got %v", entry.Background)
+	}
+}
@@ -0,0 +1,233 @@
+package chroma
+
+import "math"
+
+// A StyleTransform is a named, registered transform that can be applied to a
+// style's entries, either eagerly via StyleBuilder.Use or lazily via
+// Style.WithTransforms.
+type StyleTransform interface {
+	// Name uniquely identifies the transform, e.g. for lookup via
+	// StyleTransformByName.
+	Name() string
+	// Apply transforms a single entry. bg is the style's resolved Background
+	// entry, which contrast- and palette-aware transforms need.
+	Apply(entry StyleEntry, bg StyleEntry) StyleEntry
+}
+
+var styleTransforms = map[string]StyleTransform{}
+
+// RegisterStyleTransform registers t under its Name so it can later be
+// looked up with StyleTransformByName, e.g. by config-driven tooling that
+// only has a transform's name to go on.
+func RegisterStyleTransform(t StyleTransform) {
+	styleTransforms[t.Name()] = t
+}
+
+// StyleTransformByName looks up a StyleTransform previously registered with
+// RegisterStyleTransform.
+func StyleTransformByName(name string) (StyleTransform, bool) {
+	t, ok := styleTransforms[name]
+	return t, ok
+}
+
+const defaultMinContrastRatio = 4.5
+
+// MinContrastTransform returns a StyleTransform that lifts or darkens an
+// entry's foreground colour, leaving its background untouched, until it
+// reaches at least ratio of WCAG contrast against the style's Background. A
+// ratio of 0 uses the WCAG AA default of 4.5 for normal text.
+//
+// The colour moves in one direction only (lighter if it starts lighter than
+// the background, darker otherwise), 5% of the way to white or black per
+// step, for at most 20 steps. Where that does not reach ratio (for example a
+// foreground just lighter than a mid-grey background), the entry is returned
+// with the contrast it reached, which is below ratio.
+func MinContrastTransform(ratio float64) StyleTransform {
+	if ratio <= 0 {
+		ratio = defaultMinContrastRatio
+	}
+	return minContrastTransform{ratio: ratio}
+}
+
+type minContrastTransform struct{ ratio float64 }
+
+func (minContrastTransform) Name() string { return "min-contrast" }
+
+func (m minContrastTransform) Apply(entry StyleEntry, bg StyleEntry) StyleEntry {
+	if !entry.Colour.IsSet() || !bg.Background.IsSet() {
+		return entry
+	}
+	fg := entry.Colour
+	// The direction has to be decided once, from how fg compares to bg, not
+	// from fg's own absolute brightness: fg needs to move away from bg, so a
+	// foreground already lighter than its background gets lighter still,
+	// and one already darker gets darker still. Deciding per-iteration (or
+	// from a fixed midpoint) can walk fg towards bg instead of away from it.
+	brighten := wcagLuminance(fg) > wcagLuminance(bg.Background)
+	for i := 0; i < 20 && wcagContrast(fg, bg.Background) < m.ratio; i++ {
+		var next Colour
+		if brighten {
+			next = blendColour(fg, NewColour(255, 255, 255), 0.05)
+		} else {
+			next = blendColour(fg, NewColour(0, 0, 0), 0.05)
+		}
+		if next == fg {
+			break
+		}
+		fg = next
+	}
+	entry.Colour = fg
+	return entry
+}
+
+// blendColour moves c a fraction amount of the way towards target.
+func blendColour(c, target Colour, amount float64) Colour {
+	blend := func(from, to uint8) uint8 {
+		return uint8(math.Round(float64(from) + (float64(to)-float64(from))*amount))
+	}
+	return NewColour(blend(c.Red(), target.Red()), blend(c.Green(), target.Green()), blend(c.Blue(), target.Blue()))
+}
+
+// wcagLuminance computes the relative luminance of c per the WCAG 2.x
+// definition: L = 0.2126*R + 0.7152*G + 0.0722*B on linearized sRGB.
+func wcagLuminance(c Colour) float64 {
+	linearize := func(channel uint8) float64 {
+		v := float64(channel) / 255
+		if v <= 0.03928 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linearize(c.Red()) + 0.7152*linearize(c.Green()) + 0.0722*linearize(c.Blue())
+}
+
+// wcagContrast computes the WCAG contrast ratio between two colours:
+// (Lmax+0.05)/(Lmin+0.05).
+func wcagContrast(a, b Colour) float64 {
+	la, lb := wcagLuminance(a), wcagLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// MonochromeTransform returns a StyleTransform that converts every colour in
+// an entry to greyscale, preserving perceived brightness via the WCAG
+// luminance formula.
+func MonochromeTransform() StyleTransform { return monochromeTransform{} }
+
+type monochromeTransform struct{}
+
+func (monochromeTransform) Name() string { return "monochrome" }
+
+func (monochromeTransform) Apply(entry StyleEntry, _ StyleEntry) StyleEntry {
+	entry.Colour = greyscale(entry.Colour)
+	entry.Background = greyscale(entry.Background)
+	entry.Border = greyscale(entry.Border)
+	return entry
+}
+
+func greyscale(c Colour) Colour {
+	if !c.IsSet() {
+		return c
+	}
+	// Convert the linear luminance back to an sRGB level, so the grey has
+	// the same luminance as c.
+	l := wcagLuminance(c)
+	v := l * 12.92
+	if l > 0.03928/12.92 {
+		v = 1.055*math.Pow(l, 1/2.4) - 0.055
+	}
+	level := uint8(math.Round(v * 255))
+	return NewColour(level, level, level)
+}
+
+// HueRotateTransform returns a StyleTransform that rotates every colour in
+// an entry around the HSL colour wheel by degrees, useful for deriving
+// accessibility or colour-blind-friendly variants of an existing style.
+func HueRotateTransform(degrees float64) StyleTransform {
+	return hueRotateTransform{degrees: degrees}
+}
+
+type hueRotateTransform struct{ degrees float64 }
+
+func (hueRotateTransform) Name() string { return "hue-rotate" }
+
+func (h hueRotateTransform) Apply(entry StyleEntry, _ StyleEntry) StyleEntry {
+	entry.Colour = rotateHue(entry.Colour, h.degrees)
+	entry.Background = rotateHue(entry.Background, h.degrees)
+	entry.Border = rotateHue(entry.Border, h.degrees)
+	return entry
+}
+
+func rotateHue(c Colour, degrees float64) Colour {
+	if !c.IsSet() {
+		return c
+	}
+	h, s, l := rgbToHSL(c.Red(), c.Green(), c.Blue())
+	h = math.Mod(h+degrees, 360)
+	if h < 0 {
+		h += 360
+	}
+	r, g, b := hslToRGB(h, s, l)
+	return NewColour(r, g, b)
+}
+
+// rgbToHSL converts 8-bit sRGB channels to hue in [0,360) and saturation/
+// lightness in [0,1].
+func rgbToHSL(r, g, b uint8) (h, s, l float64) {
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	max := math.Max(rf, math.Max(gf, bf))
+	min := math.Min(rf, math.Min(gf, bf))
+	l = (max + min) / 2
+	if max == min {
+		return 0, 0, l
+	}
+	d := max - min
+	if l > 0.5 {
+		s = d / (2 - max - min)
+	} else {
+		s = d / (max + min)
+	}
+	switch max {
+	case rf:
+		h = math.Mod((gf-bf)/d, 6)
+	case gf:
+		h = (bf-rf)/d + 2
+	default:
+		h = (rf-gf)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return h, s, l
+}
+
+// hslToRGB converts hue in degrees and saturation/lightness in [0,1] back to
+// 8-bit sRGB channels.
+func hslToRGB(h, s, l float64) (r, g, b uint8) {
+	if s == 0 {
+		v := uint8(math.Round(l * 255))
+		return v, v, v
+	}
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+	var rf, gf, bf float64
+	switch {
+	case h < 60:
+		rf, gf, bf = c, x, 0
+	case h < 120:
+		rf, gf, bf = x, c, 0
+	case h < 180:
+		rf, gf, bf = 0, c, x
+	case h < 240:
+		rf, gf, bf = 0, x, c
+	case h < 300:
+		rf, gf, bf = x, 0, c
+	default:
+		rf, gf, bf = c, 0, x
+	}
+	return uint8(math.Round((rf + m) * 255)), uint8(math.Round((gf + m) * 255)), uint8(math.Round((bf + m) * 255))
+}
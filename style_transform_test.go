@@ -0,0 +1,70 @@
+package chroma
+
+import "testing"
+
+func TestMinContrastTransformDarkBackground(t *testing.T) {
+	bg := StyleEntry{Background: NewColour(40, 40, 40)}
+	entry := StyleEntry{Colour: NewColour(140, 140, 140)}
+
+	out := MinContrastTransform(4.5).Apply(entry, bg)
+
+	if ratio := wcagContrast(out.Colour, bg.Background); ratio < 4.5 {
+		t.Fatalf("expected contrast >= 4.5, got %f", ratio)
+	}
+	if wcagLuminance(out.Colour) <= wcagLuminance(entry.Colour) {
+		t.Fatalf("expected foreground to get brighter against a dark background, got %v -> %v", entry.Colour, out.Colour)
+	}
+}
+
+func TestMinContrastTransformLightBackground(t *testing.T) {
+	bg := StyleEntry{Background: NewColour(235, 235, 235)}
+	entry := StyleEntry{Colour: NewColour(140, 140, 140)}
+
+	out := MinContrastTransform(4.5).Apply(entry, bg)
+
+	if ratio := wcagContrast(out.Colour, bg.Background); ratio < 4.5 {
+		t.Fatalf("expected contrast >= 4.5, got %f", ratio)
+	}
+	if wcagLuminance(out.Colour) >= wcagLuminance(entry.Colour) {
+		t.Fatalf("expected foreground to get darker against a light background, got %v -> %v", entry.Colour, out.Colour)
+	}
+}
+
+func TestStyleWithTransformsAppliesToRuleMatch(t *testing.T) {
+	base, err := NewStyleBuilder("test", "test").
+		AddEntry(Comment, StyleEntry{Colour: NewColour(140, 140, 140)}).
+		AddEntry(Background, StyleEntry{Background: NewColour(20, 20, 20)}).
+		AddRule(Comment, "TODO", StyleEntry{Colour: NewColour(60, 60, 60)}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transformed := base.WithTransforms(MinContrastTransform(4.5))
+
+	entry := transformed.GetForToken(Token{Type: Comment, Value: "TODO: fix this"})
+
+	if ratio := wcagContrast(entry.Colour, transformed.get(Background).Background); ratio < 4.5 {
+		t.Fatalf("expected rule-matched entry to be contrast-clamped, got ratio %f", ratio)
+	}
+}
+
+func TestBuilderFromTransformedStylePreservesTransforms(t *testing.T) {
+	base, err := NewStyleBuilder("test", "test").
+		AddEntry(Comment, StyleEntry{Colour: NewColour(60, 60, 60)}).
+		AddEntry(Background, StyleEntry{Background: NewColour(20, 20, 20)}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transformed := base.WithTransforms(MinContrastTransform(4.5))
+
+	derived, err := transformed.Builder().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := derived.Get(Comment)
+	if ratio := wcagContrast(entry.Colour, derived.get(Background).Background); ratio < 4.5 {
+		t.Fatalf("expected Builder()-derived style to keep contrast clamping, got ratio %f", ratio)
+	}
+}